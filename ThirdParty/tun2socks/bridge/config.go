@@ -9,16 +9,43 @@
 
 package bridge
 
+import "time"
+
 // Config captures the runtime options surfaced to the Swift layer.
 type Config struct {
 	// MTU is the maximum transmission unit applied to the virtual interface.
 	MTU int
+
+	// MinMTU is the floor below which Engine.SetMTU will not shrink the
+	// tunnel, mirroring the safe fallback used for IPv6-in-IPv6 tunnels.
+	MinMTU int
+
+	// DNS, when set, intercepts UDP/53 and TCP/53 flows in-process instead
+	// of forwarding them to Swift. See DNSResolver.
+	DNS DNSResolver
+
+	// UDPIdleTimeout closes a UDP session after this long without a read or
+	// write. Zero disables the idle sweeper.
+	UDPIdleTimeout time.Duration
+
+	// EnableGRO turns on generic-receive-offload-style coalescing of
+	// contiguous same-flow TCP segments before they cross the FFI boundary
+	// (see gro.go). Off by default until benchmarked against real traffic.
+	EnableGRO bool
 }
 
 // PacketEmitter is implemented by Swift code to reflect outbound packets back
 // into the Network Extension packet flow.
 type PacketEmitter interface {
 	EmitPacket(packet []byte, protocolNumber int32) error
+
+	// EmitPacketBatch delivers a vector of packets in one FFI hop: packed is
+	// the concatenation of each packet's bytes, sizes holds each packet's
+	// length as a little-endian uint16 (2 bytes per packet), and protocols
+	// holds each packet's AF_INET/AF_INET6 value as a little-endian int32 (4
+	// bytes per packet). Implementations that cannot batch should return
+	// ErrBatchUnsupported so tunIO falls back to EmitPacket per packet.
+	EmitPacketBatch(packed []byte, sizes []byte, protocols []byte) error
 }
 
 // Network abstracts the Network Extension plumbing behind TCP and UDP sessions.
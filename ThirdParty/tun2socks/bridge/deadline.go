@@ -0,0 +1,83 @@
+//  deadline.go
+//  RelativeProtocol Bridge
+//
+//  Copyright (c) 2025 Relative Companies, Inc.
+//  Personal, non-commercial use only. Created by Will Kusch on 10/25/2025.
+//
+//  Shared helper for turning a net.Conn-style deadline into a channel a
+//  blocking Read/ReadFrom can select on. Mirrors the deadline type used by
+//  net.Pipe so that a deadline set (or cleared) after the read is already
+//  parked still applies to it, per the net.Conn contract.
+
+package bridge
+
+import (
+	"sync"
+	"time"
+)
+
+// pipeDeadline is a reusable read deadline. wait returns a channel that is
+// closed once the deadline elapses; set installs or clears the deadline and,
+// if it fires in the past, wakes anything already selecting on wait.
+type pipeDeadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{}
+}
+
+// makePipeDeadline returns a pipeDeadline ready for use with no deadline set.
+func makePipeDeadline() pipeDeadline {
+	return pipeDeadline{cancel: make(chan struct{})}
+}
+
+// set installs t as the new deadline. A zero t clears it. A t already in the
+// past fires immediately, waking any goroutine blocked in wait.
+func (d *pipeDeadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel // wait for the fired timer's close(d.cancel) to land
+	}
+	d.timer = nil
+
+	closed := isClosedChan(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() { close(cancel) })
+		return
+	}
+
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+// wait returns the channel that closes when the deadline elapses. A caller
+// already parked in a select on this channel observes a later set call,
+// since set closes (or replaces, if already closed) the same channel rather
+// than requiring the caller to re-fetch it.
+func (d *pipeDeadline) wait() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+func isClosedChan(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
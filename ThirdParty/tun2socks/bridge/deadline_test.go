@@ -0,0 +1,70 @@
+package bridge
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPipeDeadlineNilBlocksForever(t *testing.T) {
+	d := makePipeDeadline()
+	select {
+	case <-d.wait():
+		t.Fatalf("expected wait() to block with no deadline set")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestPipeDeadlinePastFiresImmediately(t *testing.T) {
+	d := makePipeDeadline()
+	d.set(time.Now().Add(-time.Minute))
+
+	select {
+	case <-d.wait():
+	default:
+		t.Fatalf("expected a past deadline to fire immediately")
+	}
+}
+
+func TestPipeDeadlineFutureFires(t *testing.T) {
+	d := makePipeDeadline()
+	d.set(time.Now().Add(30 * time.Millisecond))
+
+	select {
+	case <-d.wait():
+	case <-time.After(time.Second):
+		t.Fatalf("expected deadline to fire within a second")
+	}
+}
+
+func TestPipeDeadlineWakesAlreadyBlockedWaiter(t *testing.T) {
+	d := makePipeDeadline()
+	woke := make(chan struct{})
+
+	go func() {
+		<-d.wait()
+		close(woke)
+	}()
+
+	time.Sleep(10 * time.Millisecond) // let the goroutine park in wait()
+	d.set(time.Now().Add(-time.Second))
+
+	select {
+	case <-woke:
+	case <-time.After(time.Second):
+		t.Fatalf("expected set() to wake a waiter already parked in wait()")
+	}
+}
+
+func TestPipeDeadlineClearAfterFireResetsWait(t *testing.T) {
+	d := makePipeDeadline()
+	d.set(time.Now().Add(-time.Minute))
+	<-d.wait() // consume the already-fired deadline
+
+	d.set(time.Time{})
+
+	select {
+	case <-d.wait():
+		t.Fatalf("expected clearing the deadline to block wait() again")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -0,0 +1,371 @@
+//  dns.go
+//  RelativeProtocol Bridge
+//
+//  Copyright (c) 2025 Relative Companies, Inc.
+//  Personal, non-commercial use only. Created by Will Kusch on 10/23/2025.
+//
+//  Lets DNS flows be answered in-process instead of always round-tripping
+//  through the Swift-side Network Extension, so callers can implement
+//  split-DNS, blocklists, DoH/DoT upgrade, or caching.
+
+package bridge
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xjasonlyu/tun2socks/v2/log"
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+)
+
+// dnsPort is the well-known port intercepted by the DNS subsystem.
+const dnsPort = 53
+
+// DNSResolver answers a raw DNS query. msg and the returned answer are
+// wire-format DNS messages, so callers can host any resolution strategy —
+// split-DNS, blocklists, DoH/DoT upgrade, caching — in-process rather than
+// always round-tripping through the Network Extension.
+type DNSResolver interface {
+	Resolve(ctx context.Context, msg []byte) ([]byte, error)
+}
+
+// SetDNSResolver hot-swaps the active DNS resolver. Passing nil reverts to
+// forwarding DNS flows to Swift like any other destination.
+func (e *Engine) SetDNSResolver(resolver DNSResolver) {
+	e.dnsResolver.Store(&resolver)
+}
+
+func (e *Engine) dnsResolverFor() DNSResolver {
+	stored := e.dnsResolver.Load()
+	if stored == nil {
+		return nil
+	}
+	return *stored
+}
+
+// defaultDNSResolver tries a fixed list of upstream servers one at a time, in
+// order, via the existing Network adapter, returning the first successful
+// answer. It
+// preserves pre-interception behavior: a query still egresses through Swift,
+// just against a caller-chosen upstream rather than whatever the OS route
+// table picks.
+type defaultDNSResolver struct {
+	engine    *Engine
+	upstreams []string // host:port pairs
+}
+
+// NewDefaultDNSResolver builds a resolver that forwards queries to upstreams
+// (each "host:port") through engine's Network adapter, trying them in order
+// and returning the first successful answer.
+func NewDefaultDNSResolver(engine *Engine, upstreams []string) DNSResolver {
+	return &defaultDNSResolver{engine: engine, upstreams: upstreams}
+}
+
+func (r *defaultDNSResolver) Resolve(ctx context.Context, msg []byte) ([]byte, error) {
+	if len(r.upstreams) == 0 {
+		return nil, errors.New("no DNS upstreams configured")
+	}
+
+	var lastErr error
+	for _, upstream := range r.upstreams {
+		host, portStr, err := net.SplitHostPort(upstream)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		answer, err := r.query(ctx, host, int32(port), msg)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return answer, nil
+	}
+	return nil, lastErr
+}
+
+// dnsQueryTimeout bounds how long query waits for an upstream reply when ctx
+// carries no deadline of its own. DNS replies commonly get dropped in
+// transit, and without this bound a lost reply would park the goroutine on
+// session.ReadFrom forever, leaking the registered session and Swift UDP
+// handle.
+const dnsQueryTimeout = 5 * time.Second
+
+func (r *defaultDNSResolver) query(ctx context.Context, host string, port int32, msg []byte) ([]byte, error) {
+	handle, err := r.engine.network.UDPDial(host, port)
+	if err != nil {
+		return nil, err
+	}
+	defer r.engine.network.UDPClose(handle)
+
+	metadata := &M.Metadata{}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		metadata.DstIP = addr
+		metadata.DstPort = uint16(port)
+	}
+
+	session := newSwiftUDPSession(handle, metadata, r.engine)
+	r.engine.registerUDP(handle, session)
+	defer session.close()
+
+	if _, err := r.engine.network.UDPWrite(handle, msg); err != nil {
+		return nil, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(dnsQueryTimeout)
+	}
+	if err := session.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 65535)
+	n, _, err := session.ReadFrom(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// dnsUDPSession implements net.PacketConn over a DNSResolver for UDP/53
+// flows, so swiftDialer.DialUDP can hand it back without ever reaching
+// Swift.
+type dnsUDPSession struct {
+	resolver DNSResolver
+	remote   net.Addr
+	engine   *Engine
+
+	mu        sync.Mutex
+	recvQueue chan []byte
+	closed    bool
+
+	readDeadline  pipeDeadline
+	writeDeadline atomic.Pointer[time.Time]
+}
+
+func newDNSUDPSession(resolver DNSResolver, remote net.Addr, engine *Engine) *dnsUDPSession {
+	return &dnsUDPSession{
+		resolver:     resolver,
+		remote:       remote,
+		engine:       engine,
+		recvQueue:    make(chan []byte, 4),
+		readDeadline: makePipeDeadline(),
+	}
+}
+
+func (s *dnsUDPSession) ReadFrom(p []byte) (int, net.Addr, error) {
+	select {
+	case payload, ok := <-s.recvQueue:
+		if !ok {
+			return 0, s.remote, errors.New("dns session closed")
+		}
+		n := copy(p, payload)
+		return n, s.remote, nil
+	case <-s.readDeadline.wait():
+		return 0, s.remote, os.ErrDeadlineExceeded
+	}
+}
+
+func (s *dnsUDPSession) WriteTo(p []byte, _ net.Addr) (int, error) {
+	if s.isClosed() {
+		return 0, errors.New("dns session closed")
+	}
+	if wd := s.writeDeadline.Load(); wd != nil && !wd.IsZero() && !time.Now().Before(*wd) {
+		return 0, os.ErrDeadlineExceeded
+	}
+	s.engine.dnsQueries.Add(1)
+	query := append([]byte(nil), p...)
+	go func() {
+		answer, err := s.resolver.Resolve(context.Background(), query)
+		if err != nil {
+			log.Warnf("bridge: dns resolve failed: %v", err)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.closed {
+			return
+		}
+		select {
+		case s.recvQueue <- answer:
+		default:
+		}
+	}()
+	return len(p), nil
+}
+
+func (s *dnsUDPSession) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.recvQueue)
+	return nil
+}
+
+func (s *dnsUDPSession) LocalAddr() net.Addr { return &net.UDPAddr{} }
+
+func (s *dnsUDPSession) SetDeadline(t time.Time) error {
+	if err := s.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return s.SetWriteDeadline(t)
+}
+
+func (s *dnsUDPSession) SetReadDeadline(t time.Time) error {
+	s.readDeadline.set(t)
+	return nil
+}
+
+func (s *dnsUDPSession) SetWriteDeadline(t time.Time) error {
+	if t.IsZero() {
+		s.writeDeadline.Store(nil)
+		return nil
+	}
+	s.writeDeadline.Store(&t)
+	return nil
+}
+
+func (s *dnsUDPSession) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// dnsTCPConn implements net.Conn over a DNSResolver for TCP/53 flows,
+// framing each Resolve() answer with the 2-byte length prefix RFC 7766
+// requires for DNS-over-TCP. It assumes each Write carries one complete,
+// length-prefixed query, which holds for the single-shot resolvers this
+// bridge forwards traffic for.
+type dnsTCPConn struct {
+	resolver DNSResolver
+	remote   net.Addr
+	engine   *Engine
+
+	mu      sync.Mutex
+	buffer  []byte
+	closed  bool
+	replies chan []byte
+
+	readDeadline  pipeDeadline
+	writeDeadline atomic.Pointer[time.Time]
+}
+
+func newDNSTCPConn(resolver DNSResolver, remote net.Addr, engine *Engine) *dnsTCPConn {
+	return &dnsTCPConn{
+		resolver:     resolver,
+		remote:       remote,
+		engine:       engine,
+		replies:      make(chan []byte, 4),
+		readDeadline: makePipeDeadline(),
+	}
+}
+
+func (c *dnsTCPConn) Read(p []byte) (int, error) {
+	if len(c.buffer) == 0 {
+		select {
+		case reply, ok := <-c.replies:
+			if !ok {
+				return 0, errors.New("dns connection closed")
+			}
+			c.buffer = reply
+		case <-c.readDeadline.wait():
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+	n := copy(p, c.buffer)
+	c.buffer = c.buffer[n:]
+	return n, nil
+}
+
+func (c *dnsTCPConn) Write(p []byte) (int, error) {
+	if c.isClosed() {
+		return 0, errors.New("dns connection closed")
+	}
+	if wd := c.writeDeadline.Load(); wd != nil && !wd.IsZero() && !time.Now().Before(*wd) {
+		return 0, os.ErrDeadlineExceeded
+	}
+	if len(p) < 2 {
+		return 0, errors.New("truncated dns-over-tcp message")
+	}
+	c.engine.dnsQueries.Add(1)
+	msg := append([]byte(nil), p[2:]...)
+	go func() {
+		answer, err := c.resolver.Resolve(context.Background(), msg)
+		if err != nil {
+			log.Warnf("bridge: dns resolve failed: %v", err)
+			return
+		}
+		framed := make([]byte, 2+len(answer))
+		binary.BigEndian.PutUint16(framed, uint16(len(answer)))
+		copy(framed[2:], answer)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.closed {
+			return
+		}
+		select {
+		case c.replies <- framed:
+		default:
+		}
+	}()
+	return len(p), nil
+}
+
+func (c *dnsTCPConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.replies)
+	return nil
+}
+
+func (c *dnsTCPConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+func (c *dnsTCPConn) LocalAddr() net.Addr  { return &net.TCPAddr{} }
+func (c *dnsTCPConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *dnsTCPConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+func (c *dnsTCPConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+func (c *dnsTCPConn) SetWriteDeadline(t time.Time) error {
+	if t.IsZero() {
+		c.writeDeadline.Store(nil)
+		return nil
+	}
+	c.writeDeadline.Store(&t)
+	return nil
+}
@@ -14,6 +14,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/netip"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -24,6 +25,7 @@ import (
 	"github.com/xjasonlyu/tun2socks/v2/core"
 	"github.com/xjasonlyu/tun2socks/v2/core/device"
 	"github.com/xjasonlyu/tun2socks/v2/core/device/iobased"
+	"github.com/xjasonlyu/tun2socks/v2/log"
 	M "github.com/xjasonlyu/tun2socks/v2/metadata"
 	"github.com/xjasonlyu/tun2socks/v2/tunnel"
 	"github.com/xjasonlyu/tun2socks/v2/tunnel/statistic"
@@ -34,6 +36,16 @@ const (
 	afInet6 = 30 // AF_INET6
 )
 
+// tcpProtocolNumber and udpProtocolNumber mirror the IANA protocol numbers
+// used by header.TCPProtocolNumber/header.UDPProtocolNumber, as plain
+// constants swiftDialer passes to evaluateFilter.
+const (
+	tcpProtocolNumber = 6
+	udpProtocolNumber = 17
+)
+
+var errFilterRejected = errors.New("flow rejected by packet filter")
+
 // Engine wires the Go tun2socks core to the Swift-based Network Extension host.
 type Engine struct {
 	cfg Config
@@ -53,6 +65,32 @@ type Engine struct {
 
 	tcpConns map[int64]*swiftTCPConn
 	udpConns map[int64]*swiftUDPSession
+
+	lastPathID      string
+	pathMonitor     PathMonitor
+	pathChangeCount atomic.Int64
+
+	pathSubsMu sync.Mutex
+	pathSubs   []func(PathEvent)
+
+	pmtu *pmtuCache
+
+	dnsResolver atomic.Pointer[DNSResolver]
+
+	filter         atomic.Pointer[PacketFilter]
+	filterAccepted atomic.Int64
+	filterDropped  atomic.Int64
+	filterRejected atomic.Int64
+
+	lastActivity atomic.Int64 // unix nanoseconds
+
+	tcpOpened  atomic.Int64
+	tcpClosed  atomic.Int64
+	udpOpened  atomic.Int64
+	udpClosed  atomic.Int64
+	bytesIn    atomic.Int64
+	bytesOut   atomic.Int64
+	dnsQueries atomic.Int64
 }
 
 // NewEngine constructs a new bridge instance.
@@ -69,16 +107,24 @@ func NewEngine(cfg *Config, emitter PacketEmitter, network Network) (*Engine, er
 	if cfg.MTU <= 0 {
 		cfg.MTU = 1500
 	}
+	if cfg.MinMTU <= 0 {
+		cfg.MinMTU = 1280
+	}
 
 	copyCfg := *cfg
-	return &Engine{
+	engine := &Engine{
 		cfg:           copyCfg,
 		packetEmitter: emitter,
 		network:       network,
 		closing:       make(chan struct{}),
 		tcpConns:      make(map[int64]*swiftTCPConn),
 		udpConns:      make(map[int64]*swiftUDPSession),
-	}, nil
+		pmtu:          newPMTUCache(),
+	}
+	if cfg.DNS != nil {
+		engine.dnsResolver.Store(&cfg.DNS)
+	}
+	return engine, nil
 }
 
 // Start boots the underlying gVisor stack and begins processing flows.
@@ -89,7 +135,88 @@ func (e *Engine) Start() error {
 		return nil
 	}
 
-	tunRW := newTunIO(e.packetEmitter)
+	if err := e.buildStackLocked(); err != nil {
+		return err
+	}
+
+	e.running = true
+	e.runFlag.Store(true)
+	e.startIdleSweeper()
+	return nil
+}
+
+// touchActivity records in e.lastActivity that the engine observed traffic
+// just now, independent of any single connection's idle tracking (see
+// swiftUDPSession.touchActivity for the per-session equivalent used by the
+// UDP idle sweeper). Nothing in this package reads e.lastActivity.
+func (e *Engine) touchActivity() {
+	e.lastActivity.Store(time.Now().UnixNano())
+}
+
+// addBytesIn and addBytesOut accumulate the engine-wide totals surfaced by
+// Snapshot. Callers add their own per-flow counters separately (see
+// swiftTCPConn.flowStat / swiftUDPSession.flowStat); both are plain atomics
+// so the hot read/write paths never take e.mu.
+func (e *Engine) addBytesIn(n int64) {
+	e.bytesIn.Add(n)
+}
+
+func (e *Engine) addBytesOut(n int64) {
+	e.bytesOut.Add(n)
+}
+
+// startIdleSweeper periodically closes UDP sessions that have gone quiet for
+// longer than Config.UDPIdleTimeout. It is a no-op when UDPIdleTimeout is
+// unset.
+func (e *Engine) startIdleSweeper() {
+	idle := e.cfg.UDPIdleTimeout
+	if idle <= 0 {
+		return
+	}
+	interval := idle / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	closing := e.closing
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-closing:
+				return
+			case <-ticker.C:
+				e.sweepIdleUDP(idle)
+			}
+		}
+	}()
+}
+
+func (e *Engine) sweepIdleUDP(idle time.Duration) {
+	e.mu.Lock()
+	sessions := make([]*swiftUDPSession, 0, len(e.udpConns))
+	for _, sess := range e.udpConns {
+		sessions = append(sessions, sess)
+	}
+	e.mu.Unlock()
+
+	for _, sess := range sessions {
+		if sess.idleFor() >= idle {
+			sess.close()
+		}
+	}
+}
+
+// buildStackLocked (re)builds the tun device, gVisor stack and tunnel. It is
+// used both by Start and by resetEndpoint, which rebuilds the stack in place
+// after the underlying network interface identity changes. Callers must hold
+// e.mu.
+func (e *Engine) buildStackLocked() error {
+	prevStack := e.stack
+	prevDevice := e.device
+
+	tunRW := newTunIO(e.packetEmitter, e.cfg.EnableGRO)
 
 	endpoint, err := iobased.New(tunRW, uint32(e.cfg.MTU), 0)
 	if err != nil {
@@ -114,13 +241,22 @@ func (e *Engine) Start() error {
 		return fmt.Errorf("create stack: %w", err)
 	}
 
+	// Tear down the stack/endpoint this call is replacing. Every MTU change
+	// and interface-identity path change rebuilds in place, so skipping this
+	// would leak a full gVisor stack on every rebuild.
+	if prevStack != nil {
+		prevStack.Close()
+	}
+	if prevDevice != nil {
+		prevDevice.Close()
+	}
+
+	closing := e.closing
 	go func() {
-		<-e.closing
+		<-closing
 		endpoint.Wait()
 	}()
 
-	e.running = true
-	e.runFlag.Store(true)
 	return nil
 }
 
@@ -156,9 +292,55 @@ func (e *Engine) HandlePacket(packet []byte, protocolNumber int32) error {
 	if !e.IsRunning() {
 		return errors.New("engine not running")
 	}
+	if e.pmtu.observeICMP(packet) {
+		e.mu.Lock()
+		current := e.cfg.MTU
+		e.mu.Unlock()
+		if mtu := e.pmtu.globalMin(); mtu > 0 && mtu < current {
+			if err := e.SetMTU(mtu); err != nil {
+				log.Warnf("bridge: failed to shrink MTU after PMTU hint: %v", err)
+			}
+		}
+	}
+
+	if src, dst, proto, ok := parseFiveTuple(packet); ok {
+		if verdict := e.evaluateFilter(src, dst, proto, DirectionInbound); verdict != VerdictAccept {
+			return nil
+		}
+	}
+
 	return e.tun.Inject(packet, protocolNumber)
 }
 
+// SetMTU updates the tunnel MTU, typically derived from
+// NEPacketTunnelNetworkSettings.mtu on the Swift side. Values below
+// Config.MinMTU are clamped up to the floor so the endpoint is never rebuilt
+// with an MTU that would black-hole ordinary traffic. The gVisor endpoint is
+// rebuilt in place if the engine is already running.
+func (e *Engine) SetMTU(mtu int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if mtu < e.cfg.MinMTU {
+		mtu = e.cfg.MinMTU
+	}
+	if mtu == e.cfg.MTU {
+		return nil
+	}
+	e.cfg.MTU = mtu
+	if !e.running {
+		return nil
+	}
+
+	if e.tunnel != nil {
+		e.tunnel.Close()
+	}
+	if e.tun != nil {
+		e.tun.Close()
+	}
+	return e.buildStackLocked()
+}
+
 // IsRunning reports whether Start has been called successfully.
 func (e *Engine) IsRunning() bool {
 	return e.runFlag.Load()
@@ -274,6 +456,20 @@ type swiftDialer struct {
 func (d *swiftDialer) DialContext(ctx context.Context, metadata *M.Metadata) (net.Conn, error) {
 	host := metadata.DstIP.String()
 	port := int32(metadata.DstPort)
+
+	src := netip.AddrPortFrom(metadata.SrcIP, metadata.SrcPort)
+	dst := netip.AddrPortFrom(metadata.DstIP, metadata.DstPort)
+	switch d.engine.evaluateFilter(src, dst, uint8(tcpProtocolNumber), DirectionOutbound) {
+	case VerdictDrop, VerdictReject:
+		return nil, errFilterRejected
+	}
+
+	if port == dnsPort {
+		if resolver := d.engine.dnsResolverFor(); resolver != nil {
+			return newDNSTCPConn(resolver, metadata.TCPAddr(), d.engine), nil
+		}
+	}
+
 	timeout := contextDeadlineMillis(ctx)
 
 	handle, err := d.engine.network.TCPDial(host, port, timeout)
@@ -290,6 +486,19 @@ func (d *swiftDialer) DialUDP(metadata *M.Metadata) (net.PacketConn, error) {
 	host := metadata.DstIP.String()
 	port := int32(metadata.DstPort)
 
+	src := netip.AddrPortFrom(metadata.SrcIP, metadata.SrcPort)
+	dst := netip.AddrPortFrom(metadata.DstIP, metadata.DstPort)
+	switch d.engine.evaluateFilter(src, dst, uint8(udpProtocolNumber), DirectionOutbound) {
+	case VerdictDrop, VerdictReject:
+		return nil, errFilterRejected
+	}
+
+	if port == dnsPort {
+		if resolver := d.engine.dnsResolverFor(); resolver != nil {
+			return newDNSUDPSession(resolver, metadata.UDPAddr(), d.engine), nil
+		}
+	}
+
 	handle, err := d.engine.network.UDPDial(host, port)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,245 @@
+//  filter.go
+//  RelativeProtocol Bridge
+//
+//  Copyright (c) 2025 Relative Companies, Inc.
+//  Personal, non-commercial use only. Created by Will Kusch on 10/24/2025.
+//
+//  Evaluates a per-flow ACL before a packet is injected into the gVisor
+//  stack or a new flow is dialed out to Swift, so callers can block traffic
+//  without patching tun2socks itself.
+
+package bridge
+
+import (
+	"net/netip"
+
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// Direction describes which way a packet or flow is travelling relative to
+// the tunnel.
+type Direction uint8
+
+const (
+	// DirectionInbound is traffic arriving from the platform network and
+	// being injected into the gVisor stack (Engine.HandlePacket).
+	DirectionInbound Direction = iota
+	// DirectionOutbound is a new flow about to be dialed out to Swift
+	// (swiftDialer.DialContext / DialUDP).
+	DirectionOutbound
+)
+
+// FilterVerdict is the outcome of evaluating a packet or flow against the
+// active PacketFilter.
+type FilterVerdict uint8
+
+const (
+	// VerdictAccept lets the packet or flow proceed normally.
+	VerdictAccept FilterVerdict = iota
+	// VerdictDrop silently discards the packet or flow.
+	VerdictDrop
+	// VerdictReject discards the packet or flow. For dialed flows this is a
+	// dial error, which tun2socks/gVisor turns into a TCP RST or ICMP
+	// unreachable on its own. Inbound packets rejected in Engine.HandlePacket
+	// are dropped like VerdictDrop; no reply is sent to their sender.
+	VerdictReject
+)
+
+// PacketFilter evaluates a 5-tuple and returns a verdict. Implementations
+// must be safe for concurrent use; Engine may call Verdict from multiple
+// goroutines at once.
+type PacketFilter interface {
+	Verdict(src, dst netip.AddrPort, proto uint8, direction Direction) FilterVerdict
+}
+
+// Rule describes a single ACL entry. A zero CIDR, port range or Proto matches
+// anything (any CIDR, any port, any protocol). Direction always has to match
+// exactly; its zero value is DirectionInbound.
+type Rule struct {
+	CIDR      netip.Prefix
+	PortLow   uint16
+	PortHigh  uint16 // inclusive; 0 means "same as PortLow" when PortLow is set
+	Proto     uint8  // 0 means any protocol
+	Direction Direction
+	Verdict   FilterVerdict
+}
+
+const portBitmapWords = 65536 / 64
+
+// CompiledFilter is a Rule set compiled for fast evaluation: a per-protocol
+// bitmap flags which ports are covered by at least one rule so the common
+// case of "no rule applies" short-circuits before any CIDR comparison.
+type CompiledFilter struct {
+	rules   []Rule
+	covered [256]*[portBitmapWords]uint64
+}
+
+// CompileRules builds a CompiledFilter from rules, evaluated in order: the
+// first matching rule's verdict wins. Unmatched traffic defaults to
+// VerdictAccept.
+func CompileRules(rules []Rule) *CompiledFilter {
+	cf := &CompiledFilter{rules: append([]Rule(nil), rules...)}
+	for _, rule := range cf.rules {
+		low, high := rule.portRange()
+		bitmap := cf.covered[rule.Proto]
+		if bitmap == nil {
+			bitmap = &[portBitmapWords]uint64{}
+			cf.covered[rule.Proto] = bitmap
+		}
+		setPortRange(bitmap, low, high)
+
+		if rule.Proto != 0 {
+			continue
+		}
+		// A proto-agnostic rule is also marked in every protocol-specific
+		// bucket so a protocol-specific lookup still finds it covered.
+		for proto := 1; proto < len(cf.covered); proto++ {
+			b := cf.covered[proto]
+			if b == nil {
+				b = &[portBitmapWords]uint64{}
+				cf.covered[proto] = b
+			}
+			setPortRange(b, low, high)
+		}
+	}
+	return cf
+}
+
+func (r Rule) portRange() (uint16, uint16) {
+	if r.PortLow == 0 && r.PortHigh == 0 {
+		return 0, 65535
+	}
+	high := r.PortHigh
+	if high == 0 {
+		high = r.PortLow
+	}
+	return r.PortLow, high
+}
+
+func setPortRange(bitmap *[portBitmapWords]uint64, low, high uint16) {
+	for port := int(low); port <= int(high); port++ {
+		bitmap[port/64] |= 1 << uint(port%64)
+	}
+}
+
+func portCovered(bitmap *[portBitmapWords]uint64, port uint16) bool {
+	if bitmap == nil {
+		return false
+	}
+	return bitmap[port/64]&(1<<uint(port%64)) != 0
+}
+
+// Verdict implements PacketFilter.
+func (cf *CompiledFilter) Verdict(src, dst netip.AddrPort, proto uint8, direction Direction) FilterVerdict {
+	if !portCovered(cf.covered[proto], dst.Port()) && !portCovered(cf.covered[0], dst.Port()) {
+		return VerdictAccept
+	}
+
+	for _, rule := range cf.rules {
+		if rule.Proto != 0 && rule.Proto != proto {
+			continue
+		}
+		if rule.Direction != direction {
+			continue
+		}
+		low, high := rule.portRange()
+		if dst.Port() < low || dst.Port() > high {
+			continue
+		}
+		if rule.CIDR.IsValid() && !rule.CIDR.Contains(dst.Addr()) {
+			continue
+		}
+		return rule.Verdict
+	}
+	return VerdictAccept
+}
+
+// parseFiveTuple extracts a best-effort 5-tuple from a raw IPv4/IPv6 packet
+// for filter evaluation. It reads only the TCP/UDP source and destination
+// ports; ok is false for anything else (or anything too short to parse),
+// in which case callers should treat the packet as unfiltered.
+func parseFiveTuple(packet []byte) (src, dst netip.AddrPort, proto uint8, ok bool) {
+	var payload []byte
+	var srcAddr, dstAddr netip.Addr
+	var transport uint8
+
+	switch header.IPVersion(packet) {
+	case header.IPv4Version:
+		ip := header.IPv4(packet)
+		if !ip.IsValid(len(packet)) {
+			return src, dst, 0, false
+		}
+		srcAddr, _ = netip.AddrFromSlice(ip.SourceAddress().AsSlice())
+		dstAddr, _ = netip.AddrFromSlice(ip.DestinationAddress().AsSlice())
+		transport = uint8(ip.TransportProtocol())
+		payload = ip.Payload()
+	case header.IPv6Version:
+		ip := header.IPv6(packet)
+		if !ip.IsValid(len(packet)) {
+			return src, dst, 0, false
+		}
+		srcAddr, _ = netip.AddrFromSlice(ip.SourceAddress().AsSlice())
+		dstAddr, _ = netip.AddrFromSlice(ip.DestinationAddress().AsSlice())
+		transport = uint8(ip.TransportProtocol())
+		payload = ip.Payload()
+	default:
+		return src, dst, 0, false
+	}
+
+	var srcPort, dstPort uint16
+	switch transport {
+	case uint8(header.TCPProtocolNumber):
+		if len(payload) < header.TCPMinimumSize {
+			return src, dst, 0, false
+		}
+		tcp := header.TCP(payload)
+		srcPort, dstPort = tcp.SourcePort(), tcp.DestinationPort()
+	case uint8(header.UDPProtocolNumber):
+		if len(payload) < header.UDPMinimumSize {
+			return src, dst, 0, false
+		}
+		udp := header.UDP(payload)
+		srcPort, dstPort = udp.SourcePort(), udp.DestinationPort()
+	default:
+		// Non-TCP/UDP traffic (e.g. ICMP) has no ports; filter on address
+		// and protocol alone.
+	}
+
+	return netip.AddrPortFrom(srcAddr, srcPort), netip.AddrPortFrom(dstAddr, dstPort), transport, true
+}
+
+// SetFilter atomically swaps the active packet filter. Passing nil disables
+// filtering, which is the default.
+func (e *Engine) SetFilter(filter PacketFilter) {
+	e.filter.Store(&filter)
+}
+
+func (e *Engine) filterFor() PacketFilter {
+	stored := e.filter.Load()
+	if stored == nil {
+		return nil
+	}
+	return *stored
+}
+
+// evaluateFilter runs filter (if any) and bumps the matching stats counter.
+// A nil filter always accepts.
+func (e *Engine) evaluateFilter(src, dst netip.AddrPort, proto uint8, direction Direction) FilterVerdict {
+	filter := e.filterFor()
+	if filter == nil {
+		e.filterAccepted.Add(1)
+		return VerdictAccept
+	}
+
+	switch filter.Verdict(src, dst, proto, direction) {
+	case VerdictDrop:
+		e.filterDropped.Add(1)
+		return VerdictDrop
+	case VerdictReject:
+		e.filterRejected.Add(1)
+		return VerdictReject
+	default:
+		e.filterAccepted.Add(1)
+		return VerdictAccept
+	}
+}
@@ -0,0 +1,303 @@
+//  gro.go
+//  RelativeProtocol Bridge
+//
+//  Copyright (c) 2025 Relative Companies, Inc.
+//  Personal, non-commercial use only. Created by Will Kusch on 11/2/2025.
+//
+//  Coalesces contiguous same-flow TCP segments within a single outbound
+//  flush batch before they cross the FFI boundary, mirroring the generic
+//  receive offload wireguard-go relies on for its vectorized I/O win. See
+//  Config.EnableGRO.
+
+package bridge
+
+import (
+	"bytes"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// groSlotCount bounds how many distinct flows a single flush batch can hold
+// open for merging at once; a colliding flow simply evicts whatever
+// occupies its slot.
+const groSlotCount = 16
+
+// groMaxMergedIPLen caps the IP length field a merged segment may reach (the
+// IPv4 total length, or the IPv6 payload length), 64 bytes below the 16-bit
+// field's maximum.
+const groMaxMergedIPLen = 1<<16 - 1 - 64
+
+const (
+	tcpOptKindTimestamp = 8
+	tcpOptLenTimestamp  = 10
+)
+
+// groNoMergeFlags are the TCP flags that disqualify a held segment from
+// absorbing another: a SYN/FIN/RST starts or ends a connection, URG carries
+// out-of-band data tied to this specific segment, and PSH is a hint from the
+// original sender that the data should be pushed to the application
+// promptly. A segment carrying one of these flags can still be appended onto
+// a held segment without them (finishMerge carries its flags over), after
+// which the merged segment absorbs nothing further.
+const groNoMergeFlags = header.TCPFlagSyn | header.TCPFlagFin | header.TCPFlagRst | header.TCPFlagUrg | header.TCPFlagPsh
+
+// groFlowKey identifies a TCP flow for slot lookup.
+type groFlowKey struct {
+	src, dst tcpip.Address
+	srcPort  uint16
+	dstPort  uint16
+}
+
+// groGroup is the outcome of coalescing: one outbound packet plus every
+// writeRequest.done channel that must be signalled once it is emitted.
+// Merged-away requests contribute only a done channel; passthrough
+// requests (non-TCP, or TCP that couldn't merge) are a group of one.
+type groGroup struct {
+	buf   packetBuffer
+	dones []chan error
+}
+
+type groSlot struct {
+	active bool
+	key    groFlowKey
+	group  *groGroup
+}
+
+// coalesceGRO merges contiguous same-flow TCP segments in batch into as few
+// groGroups as possible. Slots are scoped to this single call, so a held
+// segment never outlives the batch's flush (tunBatchFlushDeadline or
+// tunBatchCap), matching the lifetime the request asked for.
+func coalesceGRO(batch []writeRequest) []*groGroup {
+	groups := make([]*groGroup, 0, len(batch))
+	var slots [groSlotCount]groSlot
+
+	for _, req := range batch {
+		key, ok := tcpFlowKey(req.buf.buf)
+		if !ok {
+			groups = append(groups, &groGroup{buf: req.buf, dones: []chan error{req.done}})
+			continue
+		}
+
+		slot := &slots[groSlotIndex(key)]
+		if slot.active && slot.key == key && mergeTCPSegment(&slot.group.buf, req.buf.buf) {
+			slot.group.dones = append(slot.group.dones, req.done)
+			req.buf.release()
+			continue
+		}
+
+		if slot.active {
+			groups = append(groups, slot.group)
+		}
+		slot.active = true
+		slot.key = key
+		slot.group = &groGroup{buf: req.buf, dones: []chan error{req.done}}
+	}
+
+	for i := range slots {
+		if slots[i].active {
+			groups = append(groups, slots[i].group)
+		}
+	}
+	return groups
+}
+
+// tcpFlowKey reports the 5-tuple (minus protocol, which is always TCP here)
+// for packet, or ok=false if packet isn't a well-formed IPv4/IPv6 TCP
+// segment.
+func tcpFlowKey(packet []byte) (groFlowKey, bool) {
+	var srcAddr, dstAddr tcpip.Address
+	var payload []byte
+
+	switch header.IPVersion(packet) {
+	case header.IPv4Version:
+		ip := header.IPv4(packet)
+		if !ip.IsValid(len(packet)) || ip.TransportProtocol() != header.TCPProtocolNumber {
+			return groFlowKey{}, false
+		}
+		srcAddr, dstAddr, payload = ip.SourceAddress(), ip.DestinationAddress(), ip.Payload()
+	case header.IPv6Version:
+		ip := header.IPv6(packet)
+		if !ip.IsValid(len(packet)) || ip.TransportProtocol() != header.TCPProtocolNumber {
+			return groFlowKey{}, false
+		}
+		srcAddr, dstAddr, payload = ip.SourceAddress(), ip.DestinationAddress(), ip.Payload()
+	default:
+		return groFlowKey{}, false
+	}
+
+	if len(payload) < header.TCPMinimumSize {
+		return groFlowKey{}, false
+	}
+	tcp := header.TCP(payload)
+	return groFlowKey{src: srcAddr, dst: dstAddr, srcPort: tcp.SourcePort(), dstPort: tcp.DestinationPort()}, true
+}
+
+func groSlotIndex(key groFlowKey) int {
+	h := uint32(key.srcPort)
+	h = h*31 + uint32(key.dstPort)
+	for _, b := range []byte(key.src) {
+		h = h*31 + uint32(b)
+	}
+	for _, b := range []byte(key.dst) {
+		h = h*31 + uint32(b)
+	}
+	return int(h % groSlotCount)
+}
+
+// mergeTCPSegment attempts to append next's TCP payload onto held in place,
+// recomputing headers and checksums on success. held.buf is replaced with
+// the merged packet; its previous pooled buffer, if any, is returned to the
+// pool.
+func mergeTCPSegment(held *packetBuffer, next []byte) bool {
+	switch header.IPVersion(held.buf) {
+	case header.IPv4Version:
+		return mergeTCPSegmentIPv4(held, next)
+	case header.IPv6Version:
+		return mergeTCPSegmentIPv6(held, next)
+	default:
+		return false
+	}
+}
+
+func mergeTCPSegmentIPv4(held *packetBuffer, next []byte) bool {
+	heldIP := header.IPv4(held.buf)
+	nextIP := header.IPv4(next)
+	if !heldIP.IsValid(len(held.buf)) || !nextIP.IsValid(len(next)) {
+		return false
+	}
+
+	heldTCP := header.TCP(heldIP.Payload())
+	nextTCP := header.TCP(nextIP.Payload())
+	if !tcpSegmentsMergeable(heldTCP, nextTCP) {
+		return false
+	}
+
+	nextPayload := nextTCP.Payload()
+	if int(heldIP.TotalLength())+len(nextPayload) > groMaxMergedIPLen {
+		return false
+	}
+
+	merged := append(append([]byte(nil), held.buf...), nextPayload...)
+	mergedIP := header.IPv4(merged)
+	mergedIP.SetTotalLength(uint16(len(merged)))
+	mergedTCP := header.TCP(mergedIP.Payload())
+	finishMerge(mergedTCP, nextTCP)
+
+	recomputeIPv4Checksum(mergedIP)
+	recomputeTCPChecksum(mergedTCP, mergedIP.SourceAddress(), mergedIP.DestinationAddress())
+
+	adoptMergedBuffer(held, merged)
+	return true
+}
+
+func mergeTCPSegmentIPv6(held *packetBuffer, next []byte) bool {
+	heldIP := header.IPv6(held.buf)
+	nextIP := header.IPv6(next)
+	if !heldIP.IsValid(len(held.buf)) || !nextIP.IsValid(len(next)) {
+		return false
+	}
+
+	heldTCP := header.TCP(heldIP.Payload())
+	nextTCP := header.TCP(nextIP.Payload())
+	if !tcpSegmentsMergeable(heldTCP, nextTCP) {
+		return false
+	}
+
+	nextPayload := nextTCP.Payload()
+	if len(heldIP.Payload())+len(nextPayload) > groMaxMergedIPLen {
+		return false
+	}
+
+	merged := append(append([]byte(nil), held.buf...), nextPayload...)
+	mergedIP := header.IPv6(merged)
+	mergedIP.SetPayloadLength(uint16(len(merged) - header.IPv6MinimumSize))
+	mergedTCP := header.TCP(mergedIP.Payload())
+	finishMerge(mergedTCP, nextTCP)
+
+	// IPv6 has no header checksum; only the TCP checksum needs recomputing.
+	recomputeTCPChecksum(mergedTCP, mergedIP.SourceAddress(), mergedIP.DestinationAddress())
+
+	adoptMergedBuffer(held, merged)
+	return true
+}
+
+// tcpSegmentsMergeable reports whether next's TCP segment can be appended
+// onto held: same ports, contiguous sequence numbers, identical ACK/window/
+// options, and none of the control flags that must stay on their own
+// packet (see groNoMergeFlags).
+func tcpSegmentsMergeable(held, next header.TCP) bool {
+	if held.Flags()&groNoMergeFlags != 0 {
+		return false
+	}
+	if held.SourcePort() != next.SourcePort() || held.DestinationPort() != next.DestinationPort() {
+		return false
+	}
+	if held.AckNumber() != next.AckNumber() || held.WindowSize() != next.WindowSize() {
+		return false
+	}
+	if held.DataOffset() != next.DataOffset() || !bytes.Equal(held.Options(), next.Options()) {
+		return false // options differ in length or content; don't guess
+	}
+	return held.SequenceNumber()+uint32(len(held.Payload())) == next.SequenceNumber()
+}
+
+// finishMerge copies the fields of merged that should reflect the most
+// recently received segment rather than the one it was appended to: the ACK
+// number, advertised window, control flags, and (if present) the
+// Timestamps option's TSecr field.
+func finishMerge(merged, next header.TCP) {
+	merged.SetAckNumber(next.AckNumber())
+	merged.SetWindowSize(next.WindowSize())
+	merged.SetFlags(next.Flags())
+	updateTimestampOption(merged, next)
+}
+
+// updateTimestampOption copies next's TSecr value into merged's matching
+// Timestamps option, so an ack piggybacked on the segment being merged away
+// isn't lost. merged and next are assumed to carry identical option layouts
+// (tcpSegmentsMergeable already checked DataOffset matches).
+func updateTimestampOption(merged, next header.TCP) {
+	mOpts, nOpts := merged.Options(), next.Options()
+	for i := 0; i+1 < len(mOpts) && i+1 < len(nOpts); {
+		kind := mOpts[i]
+		if kind == 0 {
+			break
+		}
+		if kind == 1 {
+			i++
+			continue
+		}
+		length := int(mOpts[i+1])
+		if length < 2 || i+length > len(mOpts) || i+length > len(nOpts) {
+			break
+		}
+		if kind == tcpOptKindTimestamp && length == tcpOptLenTimestamp {
+			copy(mOpts[i+6:i+10], nOpts[i+6:i+10])
+		}
+		i += length
+	}
+}
+
+func recomputeIPv4Checksum(ip header.IPv4) {
+	ip.SetChecksum(0)
+	ip.SetChecksum(^header.Checksum(ip[:ip.HeaderLength()], 0))
+}
+
+func recomputeTCPChecksum(tcp header.TCP, src, dst tcpip.Address) {
+	tcp.SetChecksum(0)
+	xsum := header.PseudoHeaderChecksum(header.TCPProtocolNumber, src, dst, uint16(len(tcp)))
+	xsum = header.ChecksumCombine(xsum, header.Checksum(tcp, 0))
+	tcp.SetChecksum(^xsum)
+}
+
+// adoptMergedBuffer installs merged as held's backing buffer, releasing
+// held's previous pool-backed buffer (if any) since merged is always a
+// freshly allocated plain slice.
+func adoptMergedBuffer(held *packetBuffer, merged []byte) {
+	if held.pooled {
+		releaseBuffer(held.buf)
+	}
+	held.buf = merged
+	held.pooled = false
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/xjasonlyu/tun2socks/v2/log"
 	"go.uber.org/zap"
@@ -15,16 +16,89 @@ type LogSink interface {
 	Log(level string, message string)
 }
 
+// LogSinkJSON is an optional extension of LogSink. When a sink passed to
+// SetLogSink or SetLogSinkOptions implements it, sinkCore hands over fully
+// structured records instead of a flattened string, so Swift no longer has
+// to re-parse `msg [k1=v1 k2=v2]` text to recover field types.
+//
+// record is a single JSON object: {"ts":…, "level":…, "msg":…, "caller":…,
+// "fields":{…}}. It is only valid for the duration of the call.
+type LogSinkJSON interface {
+	LogJSON(level string, record []byte)
+}
+
 const defaultLogLevel = "info"
 
+var jsonEncoderConfig = zapcore.EncoderConfig{
+	TimeKey:        "ts",
+	LevelKey:       "level",
+	NameKey:        "logger",
+	CallerKey:      "caller",
+	MessageKey:     "msg",
+	StacktraceKey:  "stacktrace",
+	LineEnding:     zapcore.DefaultLineEnding,
+	EncodeLevel:    zapcore.LowercaseLevelEncoder,
+	EncodeTime:     zapcore.ISO8601TimeEncoder,
+	EncodeDuration: zapcore.SecondsDurationEncoder,
+	EncodeCaller:   zapcore.ShortCallerEncoder,
+}
+
 // SetLogSink installs a custom zap logger that forwards entries to sink. Pass
-// a nil sink to revert to zap's production logger.
+// a nil sink to revert to zap's production logger. If sink also implements
+// LogSinkJSON, records are emitted as structured JSON; otherwise they fall
+// back to the flattened text format. Use SetLogSinkOptions to pick the
+// format explicitly or to add sampling.
 func SetLogSink(sink LogSink, level string) error {
-	if sink == nil {
+	return SetLogSinkOptions(LogSinkOptions{Sink: sink, Level: level})
+}
+
+// LogFormat selects how sinkCore hands entries to a LogSink.
+type LogFormat int
+
+const (
+	// LogFormatAuto emits structured JSON when the sink implements
+	// LogSinkJSON, falling back to flattened text otherwise. This is the
+	// zero value, so the SetLogSink helper and an unset LogSinkOptions.Format
+	// behave the same way.
+	LogFormatAuto LogFormat = iota
+	// LogFormatJSON requires the sink to implement LogSinkJSON.
+	LogFormatJSON
+	// LogFormatText always uses the flattened "msg [k1=v1]" format, even if
+	// the sink also implements LogSinkJSON.
+	LogFormatText
+)
+
+// LogSinkOptions configures SetLogSinkOptions.
+type LogSinkOptions struct {
+	// Sink receives log entries. A nil Sink reverts to zap's production
+	// logger.
+	Sink LogSink
+
+	// Level is the minimum zap level forwarded to Sink, e.g. "info" or
+	// "debug". Defaults to defaultLogLevel.
+	Level string
+
+	// Format selects JSON vs. text records. Defaults to LogFormatAuto.
+	Format LogFormat
+
+	// SampleFirst and SampleThereafter throttle high-volume events (e.g.
+	// per-packet trace logs): the first SampleFirst entries with a given
+	// message/level in SampleTick are let through, then every
+	// SampleThereafter-th one after that. Zero disables sampling.
+	SampleFirst      int
+	SampleThereafter int
+	SampleTick       time.Duration
+}
+
+// SetLogSinkOptions installs a custom zap logger per opts. Pass a zero-value
+// opts.Sink to revert to zap's production logger.
+func SetLogSinkOptions(opts LogSinkOptions) error {
+	if opts.Sink == nil {
 		log.SetLogger(zap.Must(zap.NewProduction()))
 		return nil
 	}
 
+	level := opts.Level
 	if level == "" {
 		level = defaultLogLevel
 	}
@@ -33,10 +107,34 @@ func SetLogSink(sink LogSink, level string) error {
 		return err
 	}
 
-	core := &sinkCore{
-		sink:     sink,
+	var jsonSink LogSinkJSON
+	switch opts.Format {
+	case LogFormatJSON:
+		var ok bool
+		jsonSink, ok = opts.Sink.(LogSinkJSON)
+		if !ok {
+			return fmt.Errorf("bridge: LogFormatJSON requested but sink does not implement LogSinkJSON")
+		}
+	case LogFormatText:
+		// jsonSink stays nil; writeText is used regardless of what Sink
+		// implements.
+	default:
+		jsonSink, _ = opts.Sink.(LogSinkJSON)
+	}
+
+	var core zapcore.Core = &sinkCore{
+		sink:     opts.Sink,
+		jsonSink: jsonSink,
 		minLevel: minLevel,
 	}
+	if opts.SampleFirst > 0 || opts.SampleThereafter > 0 {
+		tick := opts.SampleTick
+		if tick <= 0 {
+			tick = time.Second
+		}
+		core = zapcore.NewSampler(core, tick, opts.SampleFirst, opts.SampleThereafter)
+	}
+
 	logger := zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1))
 	log.SetLogger(logger)
 	return nil
@@ -44,6 +142,7 @@ func SetLogSink(sink LogSink, level string) error {
 
 type sinkCore struct {
 	sink     LogSink
+	jsonSink LogSinkJSON
 	minLevel zapcore.Level
 	fields   []zapcore.Field
 }
@@ -58,6 +157,7 @@ func (c *sinkCore) With(fields []zapcore.Field) zapcore.Core {
 	base = append(base, fields...)
 	return &sinkCore{
 		sink:     c.sink,
+		jsonSink: c.jsonSink,
 		minLevel: c.minLevel,
 		fields:   base,
 	}
@@ -71,6 +171,34 @@ func (c *sinkCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.C
 }
 
 func (c *sinkCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if c.jsonSink != nil {
+		return c.writeJSON(ent, fields)
+	}
+	return c.writeText(ent, fields)
+}
+
+// writeJSON marshals ent and fields via zapcore's JSON encoder, nesting all
+// fields under a "fields" key so Swift gets typed values instead of a
+// formatted string.
+func (c *sinkCore) writeJSON(ent zapcore.Entry, fields []zapcore.Field) error {
+	all := make([]zapcore.Field, 0, len(c.fields)+len(fields)+1)
+	all = append(all, zap.Namespace("fields"))
+	all = append(all, c.fields...)
+	all = append(all, fields...)
+
+	enc := zapcore.NewJSONEncoder(jsonEncoderConfig)
+	buf, err := enc.EncodeEntry(ent, all)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+
+	record := append([]byte(nil), buf.Bytes()...)
+	c.jsonSink.LogJSON(ent.Level.String(), record)
+	return nil
+}
+
+func (c *sinkCore) writeText(ent zapcore.Entry, fields []zapcore.Field) error {
 	enc := zapcore.NewMapObjectEncoder()
 	for _, field := range c.fields {
 		field.AddTo(enc)
@@ -0,0 +1,133 @@
+//  path_monitor.go
+//  RelativeProtocol Bridge
+//
+//  Copyright (c) 2025 Relative Companies, Inc.
+//  Personal, non-commercial use only. Created by Will Kusch on 10/19/2025.
+//
+//  Lets Swift forward NWPathMonitor connectivity changes into the bridge so
+//  live sessions and the gVisor endpoint can react to Wi-Fi/cellular
+//  handoffs, interface up/down events, and default route changes.
+
+package bridge
+
+import (
+	"time"
+
+	"github.com/xjasonlyu/tun2socks/v2/log"
+)
+
+// PathEvent describes a single connectivity change reported through
+// PathDidChange.
+type PathEvent struct {
+	PathID        string
+	Reachable     bool
+	IsExpensive   bool
+	IsConstrained bool
+	At            time.Time
+}
+
+// PathMonitor is implemented by platform code that watches the active
+// network path. Swift drives change notifications through
+// Engine.PathDidChange; PathMonitor only needs to answer queries about the
+// path currently in effect, e.g. so the engine can seed its last-known state
+// on (re)start without waiting for the next callback.
+type PathMonitor interface {
+	CurrentPath() PathEvent
+}
+
+// SetPathMonitor installs the platform's path monitor. Passing nil clears it.
+func (e *Engine) SetPathMonitor(monitor PathMonitor) {
+	e.mu.Lock()
+	e.pathMonitor = monitor
+	e.mu.Unlock()
+}
+
+// SubscribePathChanges registers fn to be called whenever PathDidChange
+// observes a change. fn is invoked on its own goroutine per event so a slow
+// subscriber never blocks the Swift callback thread or later path updates.
+func (e *Engine) SubscribePathChanges(fn func(PathEvent)) {
+	if fn == nil {
+		return
+	}
+	e.pathSubsMu.Lock()
+	e.pathSubs = append(e.pathSubs, fn)
+	e.pathSubsMu.Unlock()
+}
+
+// PathDidChange is called by Swift whenever NWPathMonitor reports a change to
+// the active network path. pathID identifies the underlying interface (e.g.
+// "en0", "pdp_ip0"); a change in pathID is treated as the interface identity
+// changing and forces the gVisor endpoint to be rebuilt in addition to
+// draining and re-dialing live sessions. A path that is merely no longer
+// reachable drains sessions without rebuilding the endpoint, since the same
+// interface may come back.
+func (e *Engine) PathDidChange(pathID string, reachable bool, isExpensive bool, isConstrained bool) {
+	event := PathEvent{
+		PathID:        pathID,
+		Reachable:     reachable,
+		IsExpensive:   isExpensive,
+		IsConstrained: isConstrained,
+		At:            time.Now(),
+	}
+
+	e.mu.Lock()
+	ifaceChanged := e.lastPathID != "" && e.lastPathID != pathID
+	e.lastPathID = pathID
+	e.mu.Unlock()
+
+	e.pathChangeCount.Add(1)
+	log.Infof("bridge: path changed id=%s reachable=%t expensive=%t constrained=%t", pathID, reachable, isExpensive, isConstrained)
+
+	if !reachable || ifaceChanged {
+		e.drainAndRedial()
+	}
+	if ifaceChanged {
+		e.resetEndpoint()
+	}
+
+	e.pathSubsMu.Lock()
+	subs := make([]func(PathEvent), len(e.pathSubs))
+	copy(subs, e.pathSubs)
+	e.pathSubsMu.Unlock()
+	for _, fn := range subs {
+		go fn(event)
+	}
+}
+
+// drainAndRedial re-dials every live TCP session against the new path so
+// callers don't observe a connection that silently stopped flowing data.
+// UDP sessions are left alone: Swift re-resolves them on the next write.
+func (e *Engine) drainAndRedial() {
+	e.mu.Lock()
+	conns := make([]*swiftTCPConn, 0, len(e.tcpConns))
+	for _, conn := range e.tcpConns {
+		conns = append(conns, conn)
+	}
+	e.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.redial()
+	}
+}
+
+// resetEndpoint rebuilds the gVisor endpoint and tunnel in place. It is only
+// called when the underlying interface identity has actually changed, since
+// rebuilding drops any packets already in flight on the old endpoint.
+func (e *Engine) resetEndpoint() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.running {
+		return
+	}
+
+	if e.tunnel != nil {
+		e.tunnel.Close()
+	}
+	if e.tun != nil {
+		e.tun.Close()
+	}
+
+	if err := e.buildStackLocked(); err != nil {
+		log.Warnf("bridge: failed to rebuild stack after path change: %v", err)
+	}
+}
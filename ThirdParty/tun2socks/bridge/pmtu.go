@@ -0,0 +1,129 @@
+//  pmtu.go
+//  RelativeProtocol Bridge
+//
+//  Copyright (c) 2025 Relative Companies, Inc.
+//  Personal, non-commercial use only. Created by Will Kusch on 10/22/2025.
+//
+//  Tracks path MTU hints gleaned from ICMP "packet too big" / "fragmentation
+//  needed" signals so the tunnel-wide MTU can be lowered instead of silently
+//  black-holing large packets. Hints are recorded per destination, but no
+//  per-destination or per-flow clamp is applied.
+
+package bridge
+
+import (
+	"net/netip"
+	"sync"
+
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// pmtuCache tracks the smallest MTU observed for a destination. The bridge
+// has no per-destination link to clamp MSS on — swiftTCPConn hands payloads
+// to an already-established Swift socket that does its own segmentation —
+// so a hint is only actionable at the single, tunnel-wide MTU the gVisor
+// endpoint advertises to the device in its own TCP handshakes. See
+// Engine.HandlePacket, which shrinks Config.MTU through globalMin whenever a
+// hint lowers it.
+type pmtuCache struct {
+	mu      sync.RWMutex
+	entries map[netip.Addr]int
+}
+
+func newPMTUCache() *pmtuCache {
+	return &pmtuCache{entries: make(map[netip.Addr]int)}
+}
+
+// observe records mtu for dst if it is smaller than anything previously seen
+// for that destination, reporting whether it did so.
+func (c *pmtuCache) observe(dst netip.Addr, mtu int) bool {
+	if mtu <= 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if existing, ok := c.entries[dst]; ok && mtu >= existing {
+		return false
+	}
+	c.entries[dst] = mtu
+	return true
+}
+
+// globalMin returns the smallest MTU observed across all destinations, or 0
+// if no hint has been recorded yet.
+func (c *pmtuCache) globalMin() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	min := 0
+	for _, mtu := range c.entries {
+		if min == 0 || mtu < min {
+			min = mtu
+		}
+	}
+	return min
+}
+
+// observeICMP inspects an inbound packet for ICMPv4 "fragmentation needed" or
+// ICMPv6 "packet too big" signals and records the reported MTU against the
+// destination embedded in the offending datagram, reporting whether it
+// lowered the known MTU for that destination. It never errors: malformed or
+// unrelated packets are silently ignored since this is a best-effort hint,
+// not a correctness requirement.
+func (c *pmtuCache) observeICMP(packet []byte) bool {
+	switch header.IPVersion(packet) {
+	case header.IPv4Version:
+		return c.observeICMPv4(packet)
+	case header.IPv6Version:
+		return c.observeICMPv6(packet)
+	default:
+		return false
+	}
+}
+
+func (c *pmtuCache) observeICMPv4(packet []byte) bool {
+	ip := header.IPv4(packet)
+	if !ip.IsValid(len(packet)) || ip.TransportProtocol() != header.ICMPv4ProtocolNumber {
+		return false
+	}
+	icmp := header.ICMPv4(ip.Payload())
+	if len(icmp) < header.ICMPv4MinimumSize {
+		return false
+	}
+	if icmp.Type() != header.ICMPv4DstUnreachable || icmp.Code() != header.ICMPv4FragmentationNeeded {
+		return false
+	}
+
+	embedded := header.IPv4(icmp.Payload())
+	if !embedded.IsValid(len(icmp.Payload())) {
+		return false
+	}
+	dst, ok := netip.AddrFromSlice(embedded.DestinationAddress().AsSlice())
+	if !ok {
+		return false
+	}
+	return c.observe(dst, int(icmp.MTU()))
+}
+
+func (c *pmtuCache) observeICMPv6(packet []byte) bool {
+	ip := header.IPv6(packet)
+	if !ip.IsValid(len(packet)) || ip.TransportProtocol() != header.ICMPv6ProtocolNumber {
+		return false
+	}
+	icmp := header.ICMPv6(ip.Payload())
+	if len(icmp) < header.ICMPv6MinimumSize {
+		return false
+	}
+	if icmp.Type() != header.ICMPv6PacketTooBig {
+		return false
+	}
+
+	embedded := header.IPv6(icmp.Payload())
+	if !embedded.IsValid(len(icmp.Payload())) {
+		return false
+	}
+	dst, ok := netip.AddrFromSlice(embedded.DestinationAddress().AsSlice())
+	if !ok {
+		return false
+	}
+	return c.observe(dst, int(icmp.MTU()))
+}
@@ -12,14 +12,16 @@ import (
 	"errors"
 	"io"
 	"net"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	M "github.com/xjasonlyu/tun2socks/v2/metadata"
 )
 
 type swiftTCPConn struct {
-	handle int64
+	handle atomic.Int64
 	engine *Engine
 
 	remote net.Addr
@@ -29,6 +31,13 @@ type swiftTCPConn struct {
 	buffer    []byte
 	closed    bool
 	closeErr  error
+
+	readDeadline  pipeDeadline
+	writeDeadline atomic.Pointer[time.Time]
+
+	opened   time.Time
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
 }
 
 const tcpRecvQueueDepth = 16
@@ -42,12 +51,16 @@ func newSwiftTCPConn(handle int64, metadata *M.Metadata, engine *Engine) *swiftT
 			Port: int(metadata.DstPort),
 		}
 	}
-	return &swiftTCPConn{
-		handle:    handle,
-		engine:    engine,
-		remote:    remote,
-		recvQueue: make(chan pooledBytes, tcpRecvQueueDepth),
+	conn := &swiftTCPConn{
+		engine:       engine,
+		remote:       remote,
+		recvQueue:    make(chan pooledBytes, tcpRecvQueueDepth),
+		readDeadline: makePipeDeadline(),
+		opened:       time.Now(),
 	}
+	conn.handle.Store(handle)
+	engine.tcpOpened.Add(1)
+	return conn
 }
 
 func (c *swiftTCPConn) Read(p []byte) (int, error) {
@@ -56,6 +69,7 @@ func (c *swiftTCPConn) Read(p []byte) (int, error) {
 		n := copy(p, c.buffer)
 		c.buffer = c.buffer[n:]
 		c.mu.Unlock()
+		c.countRead(n)
 		return n, nil
 	}
 	if c.closed && len(c.buffer) == 0 {
@@ -68,15 +82,21 @@ func (c *swiftTCPConn) Read(p []byte) (int, error) {
 	}
 	c.mu.Unlock()
 
-	payload, ok := <-c.recvQueue
-	if !ok {
-		c.mu.Lock()
-		err := c.closeErr
-		c.mu.Unlock()
-		if err == nil {
-			err = io.EOF
+	var payload pooledBytes
+	select {
+	case received, ok := <-c.recvQueue:
+		if !ok {
+			c.mu.Lock()
+			err := c.closeErr
+			c.mu.Unlock()
+			if err == nil {
+				err = io.EOF
+			}
+			return 0, err
 		}
-		return 0, err
+		payload = received
+	case <-c.readDeadline.wait():
+		return 0, os.ErrDeadlineExceeded
 	}
 	defer payload.release()
 
@@ -87,22 +107,49 @@ func (c *swiftTCPConn) Read(p []byte) (int, error) {
 		c.buffer = append(c.buffer, data[n:]...)
 		c.mu.Unlock()
 	}
+	c.countRead(n)
 	return n, nil
 }
 
+// countRead accumulates bytes delivered to the caller into both the
+// per-connection and engine-wide totals surfaced by Engine.Snapshot.
+func (c *swiftTCPConn) countRead(n int) {
+	if n <= 0 {
+		return
+	}
+	c.bytesIn.Add(int64(n))
+	c.engine.addBytesIn(int64(n))
+}
+
 func (c *swiftTCPConn) Write(p []byte) (int, error) {
 	if c.isClosed() {
 		return 0, errors.New("connection closed")
 	}
+	if wd := c.writeDeadline.Load(); wd != nil && !wd.IsZero() && !time.Now().Before(*wd) {
+		return 0, os.ErrDeadlineExceeded
+	}
 	c.engine.touchActivity()
-	n, err := c.engine.network.TCPWrite(c.handle, p)
+
+	n, err := c.engine.network.TCPWrite(c.handle.Load(), p)
+	c.countWrite(int(n))
 	return int(n), err
 }
 
+// countWrite accumulates bytes handed to Swift into both the
+// per-connection and engine-wide totals surfaced by Engine.Snapshot.
+func (c *swiftTCPConn) countWrite(n int) {
+	if n <= 0 {
+		return
+	}
+	c.bytesOut.Add(int64(n))
+	c.engine.addBytesOut(int64(n))
+}
+
 func (c *swiftTCPConn) Close() error {
 	if c.markClosed(nil) {
-		c.engine.unregisterTCP(c.handle)
-		return c.engine.network.TCPClose(c.handle)
+		handle := c.handle.Load()
+		c.engine.unregisterTCP(handle)
+		return c.engine.network.TCPClose(handle)
 	}
 	return nil
 }
@@ -116,17 +163,58 @@ func (c *swiftTCPConn) RemoteAddr() net.Addr {
 }
 
 func (c *swiftTCPConn) SetDeadline(t time.Time) error {
-	return nil
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
 }
 
 func (c *swiftTCPConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
 	return nil
 }
 
 func (c *swiftTCPConn) SetWriteDeadline(t time.Time) error {
+	if t.IsZero() {
+		c.writeDeadline.Store(nil)
+		return nil
+	}
+	c.writeDeadline.Store(&t)
 	return nil
 }
 
+// redial tears down the Swift-side socket backing this connection and opens
+// a fresh one to the same remote, swapping in the new handle transparently
+// so callers holding the net.Conn never see the change. It is used to carry
+// live sessions across a path change (see PathDidChange).
+func (c *swiftTCPConn) redial() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	remote := c.remote
+	oldHandle := c.handle.Load()
+	c.mu.Unlock()
+
+	tcpAddr, ok := remote.(*net.TCPAddr)
+	if !ok {
+		return
+	}
+
+	newHandle, err := c.engine.network.TCPDial(tcpAddr.IP.String(), int32(tcpAddr.Port), 0)
+	if err != nil {
+		c.engine.network.TCPClose(oldHandle)
+		c.closeWithError(err)
+		return
+	}
+
+	c.engine.unregisterTCP(oldHandle)
+	c.engine.network.TCPClose(oldHandle)
+	c.handle.Store(newHandle)
+	c.engine.registerTCP(newHandle, c)
+}
+
 func (c *swiftTCPConn) enqueue(payload []byte) {
 	c.mu.Lock()
 	if c.closed {
@@ -157,5 +245,18 @@ func (c *swiftTCPConn) markClosed(err error) bool {
 	}
 	c.closed = true
 	c.closeErr = err
+	c.engine.tcpClosed.Add(1)
 	return true
 }
+
+// flowStat reports this connection's contribution to Engine.Snapshot's
+// top-N flow breakdown.
+func (c *swiftTCPConn) flowStat() FlowStat {
+	return FlowStat{
+		Handle: c.handle.Load(),
+		Proto:  "tcp",
+		Remote: c.remote.String(),
+		Bytes:  c.bytesIn.Load() + c.bytesOut.Load(),
+		Age:    time.Since(c.opened),
+	}
+}
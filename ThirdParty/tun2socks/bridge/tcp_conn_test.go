@@ -0,0 +1,104 @@
+package bridge
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// fakeNetwork is a minimal Network stub for exercising swiftTCPConn in
+// isolation, without a real Swift-side socket.
+type fakeNetwork struct {
+	writeCalls int
+}
+
+func (n *fakeNetwork) TCPDial(host string, port int32, timeoutMillis int64) (int64, error) {
+	return 0, errors.New("not implemented")
+}
+
+func (n *fakeNetwork) TCPWrite(handle int64, payload []byte) (int32, error) {
+	n.writeCalls++
+	return int32(len(payload)), nil
+}
+
+func (n *fakeNetwork) TCPClose(handle int64) error { return nil }
+
+func (n *fakeNetwork) UDPDial(host string, port int32) (int64, error) {
+	return 0, errors.New("not implemented")
+}
+
+func (n *fakeNetwork) UDPWrite(handle int64, payload []byte) (int32, error) {
+	return int32(len(payload)), nil
+}
+
+func (n *fakeNetwork) UDPClose(handle int64) error { return nil }
+
+func newTestTCPConn(network Network) *swiftTCPConn {
+	engine := &Engine{network: network, closing: make(chan struct{})}
+	conn := &swiftTCPConn{
+		engine:       engine,
+		remote:       &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 443},
+		recvQueue:    make(chan pooledBytes, tcpRecvQueueDepth),
+		readDeadline: makePipeDeadline(),
+		opened:       time.Now(),
+	}
+	conn.handle.Store(1)
+	return conn
+}
+
+func TestSwiftTCPConnReadUnblocksOnDeadline(t *testing.T) {
+	conn := newTestTCPConn(&fakeNetwork{})
+
+	if err := conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatalf("SetReadDeadline failed: %v", err)
+	}
+
+	_, err := conn.Read(make([]byte, 16))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected os.ErrDeadlineExceeded, got %v", err)
+	}
+}
+
+func TestSwiftTCPConnReadSucceedsAfterDeadlineCleared(t *testing.T) {
+	conn := newTestTCPConn(&fakeNetwork{})
+
+	if err := conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
+		t.Fatalf("SetReadDeadline failed: %v", err)
+	}
+	if _, err := conn.Read(make([]byte, 16)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected os.ErrDeadlineExceeded, got %v", err)
+	}
+
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		t.Fatalf("clearing SetReadDeadline failed: %v", err)
+	}
+
+	conn.enqueue([]byte("hello"))
+	buf := make([]byte, 16)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Read failed after clearing deadline: %v", err)
+	}
+	if string(buf[:n]) != "hello" {
+		t.Fatalf("Read = %q, want %q", buf[:n], "hello")
+	}
+}
+
+func TestSwiftTCPConnWriteFailsFastOnPastDeadline(t *testing.T) {
+	network := &fakeNetwork{}
+	conn := newTestTCPConn(network)
+
+	if err := conn.SetWriteDeadline(time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("SetWriteDeadline failed: %v", err)
+	}
+
+	_, err := conn.Write([]byte("payload"))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected os.ErrDeadlineExceeded, got %v", err)
+	}
+	if network.writeCalls != 0 {
+		t.Fatalf("expected Write to short-circuit, but network saw %d calls", network.writeCalls)
+	}
+}
@@ -5,27 +5,70 @@
 //  Personal, non-commercial use only. Created by Will Kusch on 10/19/2025.
 //
 //  Provides a channel-backed conduit between Swift packet emission/ingestion
-//  and the Go tun device abstraction.
+//  and the Go tun device abstraction. Outbound packets are coalesced into
+//  batches before crossing the FFI boundary, mirroring the vectorized I/O
+//  wireguard-go and Tailscale use between their tun.Device and conn.Bind.
 
 package bridge
 
-import "errors"
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
 
-const tunInboundDepth = 128
+const (
+	tunInboundDepth  = 128
+	tunOutboundDepth = 128
+
+	// tunBatchCap bounds how many packets a single EmitPacketBatch call
+	// carries.
+	tunBatchCap = 32
+
+	// tunBatchFlushDeadline bounds how long a partial batch waits for more
+	// packets before being flushed, so a quiet tunnel never adds more than
+	// this much latency to a lone packet.
+	tunBatchFlushDeadline = 250 * time.Microsecond
+
+	sizeFieldBytes  = 2 // little-endian uint16 per packet in EmitPacketBatch's sizes
+	protoFieldBytes = 4 // little-endian int32 per packet in EmitPacketBatch's protocols
+)
+
+// ErrBatchUnsupported lets a PacketEmitter opt out of EmitPacketBatch at
+// runtime; tunIO falls back to one EmitPacket call per packet in the batch.
+var ErrBatchUnsupported = errors.New("bridge: batch emission not supported")
+
+// writeRequest carries one Write call's packet through the batching
+// pipeline; done is signalled once the batch containing it has been
+// emitted, so Write can block for the real result like a synchronous call.
+type writeRequest struct {
+	buf  packetBuffer
+	done chan error
+}
 
 type tunIO struct {
 	emitter PacketEmitter
 
-	inbound chan pooledBytes
-	closed  chan struct{}
+	// enableGRO gates coalesceGRO in flushBatch; see Config.EnableGRO.
+	enableGRO bool
+
+	inbound  chan pooledBytes
+	outbound chan writeRequest
+	closed   chan struct{}
+	flushed  chan struct{}
 }
 
-func newTunIO(emitter PacketEmitter) *tunIO {
-	return &tunIO{
-		emitter: emitter,
-		inbound: make(chan pooledBytes, tunInboundDepth),
-		closed:  make(chan struct{}),
+func newTunIO(emitter PacketEmitter, enableGRO bool) *tunIO {
+	t := &tunIO{
+		emitter:   emitter,
+		enableGRO: enableGRO,
+		inbound:   make(chan pooledBytes, tunInboundDepth),
+		outbound:  make(chan writeRequest, tunOutboundDepth),
+		closed:    make(chan struct{}),
+		flushed:   make(chan struct{}),
 	}
+	go t.flushLoop()
+	return t
 }
 
 func (t *tunIO) Read(p []byte) (int, error) {
@@ -48,17 +91,175 @@ func (t *tunIO) Read(p []byte) (int, error) {
 	}
 }
 
+// Write hands a single outbound packet to the batching pipeline and blocks
+// until the batch it ends up in has been emitted, returning that flush's
+// error. A lone packet with nothing else queued still resolves in one
+// EmitPacket call (see emit), so callers observe the same sync-call
+// semantics as before batching was added.
 func (t *tunIO) Write(p []byte) (int, error) {
-	packet := newPooledBytes(p)
-	defer packet.release()
+	buf := newPooledPacketBuffer(len(p))
+	copy(buf.buf, p)
+	buf.proto = inferProtocol(buf.buf)
 
-	data := packet.bytes()
-	if err := t.emitter.EmitPacket(data, inferProtocol(data)); err != nil {
+	req := writeRequest{buf: buf, done: make(chan error, 1)}
+	select {
+	case <-t.closed:
+		buf.release()
+		return 0, errors.New("tun closed")
+	case t.outbound <- req:
+	}
+
+	if err := <-req.done; err != nil {
 		return 0, err
 	}
 	return len(p), nil
 }
 
+// flushLoop coalesces writeRequests pulled off t.outbound into batches of up
+// to tunBatchCap, flushing early once that cap is hit or once
+// tunBatchFlushDeadline elapses since the first packet in the batch arrived.
+func (t *tunIO) flushLoop() {
+	defer close(t.flushed)
+
+	batch := make([]writeRequest, 0, tunBatchCap)
+	var timer *time.Timer
+	var timerC <-chan time.Time
+
+	for {
+		select {
+		case req := <-t.outbound:
+			batch = append(batch, req)
+			if len(batch) >= tunBatchCap {
+				if timer != nil {
+					timer.Stop()
+				}
+				timerC = nil
+				t.flushBatch(batch)
+				batch = batch[:0]
+				continue
+			}
+			if len(batch) == 1 {
+				if timer == nil {
+					timer = time.NewTimer(tunBatchFlushDeadline)
+				} else {
+					timer.Reset(tunBatchFlushDeadline)
+				}
+				timerC = timer.C
+			}
+		case <-timerC:
+			timerC = nil
+			t.flushBatch(batch)
+			batch = batch[:0]
+		case <-t.closed:
+			t.flushBatch(batch)
+			t.drainOutbound()
+			return
+		}
+	}
+}
+
+// drainOutbound flushes whatever is still sitting in the outbound channel's
+// buffer after close, so a Write that enqueued just before shutdown doesn't
+// block on req.done forever.
+func (t *tunIO) drainOutbound() {
+	for {
+		select {
+		case req := <-t.outbound:
+			t.flushBatch([]writeRequest{req})
+		default:
+			return
+		}
+	}
+}
+
+func (t *tunIO) flushBatch(batch []writeRequest) {
+	if len(batch) == 0 {
+		return
+	}
+
+	var groups []*groGroup
+	if t.enableGRO {
+		groups = coalesceGRO(batch)
+	} else {
+		groups = make([]*groGroup, len(batch))
+		for i, req := range batch {
+			groups[i] = &groGroup{buf: req.buf, dones: []chan error{req.done}}
+		}
+	}
+
+	bufs := make([]packetBuffer, len(groups))
+	for i, g := range groups {
+		bufs[i] = g.buf
+	}
+	err := t.emit(bufs)
+	for _, g := range groups {
+		for _, done := range g.dones {
+			done <- err
+		}
+	}
+}
+
+// emit flushes a coalesced batch of outbound packets to the emitter,
+// falling back to one EmitPacket call per packet when the batch is a single
+// packet or the emitter opts out of batching via ErrBatchUnsupported.
+func (t *tunIO) emit(batch []packetBuffer) error {
+	defer releaseBatch(batch)
+
+	if len(batch) == 1 {
+		pkt := batch[0]
+		return t.emitter.EmitPacket(pkt.buf, pkt.proto)
+	}
+
+	packed, sizes, protocols := packBatch(batch)
+	err := t.emitter.EmitPacketBatch(packed, sizes, protocols)
+	if errors.Is(err, ErrBatchUnsupported) {
+		return t.emitIndividually(batch)
+	}
+	return err
+}
+
+func (t *tunIO) emitIndividually(batch []packetBuffer) error {
+	for _, pkt := range batch {
+		if err := t.emitter.EmitPacket(pkt.buf, pkt.proto); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// packBatch concatenates each packet's bytes into one contiguous buffer
+// alongside parallel sizes (little-endian uint16 per packet) and protocols
+// (little-endian int32 per packet) slices, matching the framing
+// EmitPacketBatch expects.
+func packBatch(batch []packetBuffer) (packed, sizes, protocols []byte) {
+	total := 0
+	for _, pkt := range batch {
+		total += len(pkt.buf)
+	}
+	packed = make([]byte, 0, total)
+	sizes = make([]byte, 0, len(batch)*sizeFieldBytes)
+	protocols = make([]byte, 0, len(batch)*protoFieldBytes)
+
+	var sizeField [sizeFieldBytes]byte
+	var protoField [protoFieldBytes]byte
+	for _, pkt := range batch {
+		packed = append(packed, pkt.buf...)
+
+		binary.LittleEndian.PutUint16(sizeField[:], uint16(len(pkt.buf)))
+		sizes = append(sizes, sizeField[:]...)
+
+		binary.LittleEndian.PutUint32(protoField[:], uint32(pkt.proto))
+		protocols = append(protocols, protoField[:]...)
+	}
+	return packed, sizes, protocols
+}
+
+func releaseBatch(batch []packetBuffer) {
+	for i := range batch {
+		batch[i].release()
+	}
+}
+
 func (t *tunIO) Close() {
 	select {
 	case <-t.closed:
@@ -66,10 +267,13 @@ func (t *tunIO) Close() {
 	default:
 		close(t.closed)
 		close(t.inbound)
+		<-t.flushed
 	}
 }
 
-func (t *tunIO) Inject(packet []byte) error {
+// Inject delivers a single packet read from the Swift packet flow into the
+// tun device, as if it had arrived on the virtual interface.
+func (t *tunIO) Inject(packet []byte, protocolNumber int32) error {
 	select {
 	case <-t.closed:
 		return errors.New("tun closed")
@@ -77,3 +281,23 @@ func (t *tunIO) Inject(packet []byte) error {
 		return nil
 	}
 }
+
+// InjectBatch splits packed into individual packets using sizes (each
+// packet's length in bytes, in the order they appear in packed) and injects
+// them in order, so Swift can deliver a vector of packets read from the
+// packet flow in a single FFI hop instead of one Inject call per packet.
+func (t *tunIO) InjectBatch(packed []byte, sizes []uint16) error {
+	offset := 0
+	for _, size := range sizes {
+		n := int(size)
+		if offset+n > len(packed) {
+			return errors.New("bridge: batch sizes overrun packed buffer")
+		}
+		pkt := packed[offset : offset+n]
+		if err := t.Inject(pkt, inferProtocol(pkt)); err != nil {
+			return err
+		}
+		offset += n
+	}
+	return nil
+}
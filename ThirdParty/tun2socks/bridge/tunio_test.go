@@ -1,62 +1,175 @@
 package bridge
 
 import (
-    "bytes"
-    "testing"
+	"bytes"
+	"sync"
+	"testing"
 )
 
+type emittedBatch struct {
+	packed    []byte
+	sizes     []byte
+	protocols []byte
+}
+
 type testEmitter struct {
-    packets [][]byte
-    protocols []int32
+	packets   [][]byte
+	protocols []int32
+	batches   []emittedBatch
 }
 
 func (e *testEmitter) EmitPacket(packet []byte, protocolNumber int32) error {
-    e.packets = append(e.packets, packet)
-    e.protocols = append(e.protocols, protocolNumber)
-    return nil
+	e.packets = append(e.packets, packet)
+	e.protocols = append(e.protocols, protocolNumber)
+	return nil
 }
 
 func (e *testEmitter) EmitPacketBatch(packed []byte, sizes []byte, protocols []byte) error {
-    return nil
+	e.batches = append(e.batches, emittedBatch{packed: packed, sizes: sizes, protocols: protocols})
+	return nil
 }
 
 func TestTunIOWriteCopiesPacket(t *testing.T) {
-    emitter := &testEmitter{}
-    tun := newTunIO(emitter)
+	emitter := &testEmitter{}
+	tun := newTunIO(emitter, false)
+	defer tun.Close()
+
+	original := []byte{0x45, 0x00, 0x00, 0x14}
+	if _, err := tun.Write(original); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	original[0] = 0x99
+
+	if len(emitter.packets) != 1 {
+		t.Fatalf("expected 1 emitted packet, got %d", len(emitter.packets))
+	}
+	if bytes.Equal(emitter.packets[0], original) {
+		t.Fatalf("expected emitted packet to be a copy, but it tracked original slice")
+	}
+}
 
-    original := []byte{0x45, 0x00, 0x00, 0x14}
-    if _, err := tun.Write(original); err != nil {
-        t.Fatalf("write failed: %v", err)
-    }
+func TestTunIOWriteBatchDoesNotAliasSource(t *testing.T) {
+	emitter := &testEmitter{}
+	tun := newTunIO(emitter, false)
+	defer tun.Close()
 
-    original[0] = 0x99
+	a := []byte{0x01, 0x02}
+	b := []byte{0x03, 0x04, 0x05}
+	wantA := append([]byte(nil), a...)
+	wantB := append([]byte(nil), b...)
 
-    if len(emitter.packets) != 1 {
-        t.Fatalf("expected 1 emitted packet, got %d", len(emitter.packets))
-    }
-    if bytes.Equal(emitter.packets[0], original) {
-        t.Fatalf("expected emitted packet to be a copy, but it tracked original slice")
-    }
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if _, err := tun.Write(a); err != nil {
+			t.Errorf("write a failed: %v", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if _, err := tun.Write(b); err != nil {
+			t.Errorf("write b failed: %v", err)
+		}
+	}()
+	wg.Wait()
+
+	// Mutate both sources now that Write has returned. Whether the two
+	// packets landed in one EmitPacketBatch call or two separate EmitPacket
+	// calls, every byte slice testEmitter captured must be an independent
+	// copy, matching the single-packet invariant in
+	// TestTunIOWriteCopiesPacket.
+	a[0] = 0xff
+	b[0] = 0xff
+
+	for _, pkt := range emitter.packets {
+		if bytes.Equal(pkt, wantA) || bytes.Equal(pkt, wantB) {
+			continue
+		}
+		t.Fatalf("emitted packet %x matches neither original payload", pkt)
+	}
+	for _, batch := range emitter.batches {
+		if bytes.Contains(batch.packed, []byte{0xff}) {
+			t.Fatalf("batched packed buffer aliases a mutated source: %x", batch.packed)
+		}
+	}
+}
+
+func TestPackBatchFraming(t *testing.T) {
+	batch := []packetBuffer{
+		adoptPacketBuffer([]byte{0x01, 0x02}, afInet),
+		adoptPacketBuffer([]byte{0x03, 0x04, 0x05}, afInet6),
+	}
+
+	packed, sizes, protocols := packBatch(batch)
+
+	wantPacked := []byte{0x01, 0x02, 0x03, 0x04, 0x05}
+	if !bytes.Equal(packed, wantPacked) {
+		t.Fatalf("packed = %x, want %x", packed, wantPacked)
+	}
+
+	wantSizes := []byte{2, 0, 3, 0} // little-endian uint16: 2, then 3
+	if !bytes.Equal(sizes, wantSizes) {
+		t.Fatalf("sizes = %x, want %x", sizes, wantSizes)
+	}
+
+	wantProtocols := []byte{afInet, 0, 0, 0, afInet6, 0, 0, 0} // little-endian int32 per packet
+	if !bytes.Equal(protocols, wantProtocols) {
+		t.Fatalf("protocols = %x, want %x", protocols, wantProtocols)
+	}
 }
 
 func TestTunIOInjectAndRead(t *testing.T) {
-    emitter := &testEmitter{}
-    tun := newTunIO(emitter)
-
-    payload := []byte{0xde, 0xad, 0xbe, 0xef}
-    if err := tun.Inject(payload); err != nil {
-        t.Fatalf("inject failed: %v", err)
-    }
-
-    buf := make([]byte, 8)
-    n, err := tun.Read(buf)
-    if err != nil {
-        t.Fatalf("read failed: %v", err)
-    }
-    if n != len(payload) {
-        t.Fatalf("expected %d bytes, got %d", len(payload), n)
-    }
-    if !bytes.Equal(buf[:n], payload) {
-        t.Fatalf("unexpected payload: %x", buf[:n])
-    }
+	emitter := &testEmitter{}
+	tun := newTunIO(emitter, false)
+	defer tun.Close()
+
+	payload := []byte{0xde, 0xad, 0xbe, 0xef}
+	if err := tun.Inject(payload, afInet); err != nil {
+		t.Fatalf("inject failed: %v", err)
+	}
+
+	buf := make([]byte, 8)
+	n, err := tun.Read(buf)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if n != len(payload) {
+		t.Fatalf("expected %d bytes, got %d", len(payload), n)
+	}
+	if !bytes.Equal(buf[:n], payload) {
+		t.Fatalf("unexpected payload: %x", buf[:n])
+	}
+}
+
+func TestTunIOInjectBatchSplitsAndPreservesOrder(t *testing.T) {
+	emitter := &testEmitter{}
+	tun := newTunIO(emitter, false)
+	defer tun.Close()
+
+	packed := []byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee}
+	sizes := []uint16{2, 3}
+
+	if err := tun.InjectBatch(packed, sizes); err != nil {
+		t.Fatalf("inject batch failed: %v", err)
+	}
+
+	buf := make([]byte, 8)
+
+	n, err := tun.Read(buf)
+	if err != nil {
+		t.Fatalf("read first packet failed: %v", err)
+	}
+	if !bytes.Equal(buf[:n], []byte{0xaa, 0xbb}) {
+		t.Fatalf("first packet = %x, want aabb", buf[:n])
+	}
+
+	n, err = tun.Read(buf)
+	if err != nil {
+		t.Fatalf("read second packet failed: %v", err)
+	}
+	if !bytes.Equal(buf[:n], []byte{0xcc, 0xdd, 0xee}) {
+		t.Fatalf("second packet = %x, want ccddee", buf[:n])
+	}
 }
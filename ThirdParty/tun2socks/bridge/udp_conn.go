@@ -11,7 +11,9 @@ package bridge
 import (
 	"errors"
 	"net"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	M "github.com/xjasonlyu/tun2socks/v2/metadata"
@@ -26,6 +28,16 @@ type swiftUDPSession struct {
 	mu        sync.Mutex
 	recvQueue chan []byte
 	closed    bool
+	closing   chan struct{}
+
+	readDeadline  pipeDeadline
+	writeDeadline atomic.Pointer[time.Time]
+
+	lastActivity atomic.Int64 // unix nanoseconds; read by the idle sweeper
+
+	opened   time.Time
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
 }
 
 func newSwiftUDPSession(handle int64, metadata *M.Metadata, engine *Engine) *swiftUDPSession {
@@ -37,21 +49,34 @@ func newSwiftUDPSession(handle int64, metadata *M.Metadata, engine *Engine) *swi
 			Port: int(metadata.DstPort),
 		}
 	}
-	return &swiftUDPSession{
-		handle:    handle,
-		engine:    engine,
-		remote:    remote,
-		recvQueue: make(chan []byte, 64),
+	s := &swiftUDPSession{
+		handle:       handle,
+		engine:       engine,
+		remote:       remote,
+		recvQueue:    make(chan []byte, 64),
+		closing:      make(chan struct{}),
+		readDeadline: makePipeDeadline(),
+		opened:       time.Now(),
 	}
+	s.touchActivity()
+	engine.udpOpened.Add(1)
+	return s
 }
 
 func (s *swiftUDPSession) ReadFrom(p []byte) (int, net.Addr, error) {
-	payload, ok := <-s.recvQueue
-	if !ok {
+	select {
+	case payload, ok := <-s.recvQueue:
+		if !ok {
+			return 0, s.remote, errors.New("udp session closed")
+		}
+		n := copy(p, payload)
+		s.countRead(n)
+		return n, s.remote, nil
+	case <-s.closing:
 		return 0, s.remote, errors.New("udp session closed")
+	case <-s.readDeadline.wait():
+		return 0, s.remote, os.ErrDeadlineExceeded
 	}
-	n := copy(p, payload)
-	return n, s.remote, nil
 }
 
 func (s *swiftUDPSession) WriteTo(p []byte, addr net.Addr) (int, error) {
@@ -59,13 +84,20 @@ func (s *swiftUDPSession) WriteTo(p []byte, addr net.Addr) (int, error) {
 	if s.isClosed() {
 		return 0, errors.New("udp session closed")
 	}
+	if wd := s.writeDeadline.Load(); wd != nil && !wd.IsZero() && !time.Now().Before(*wd) {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	s.touchActivity()
 	n, err := s.engine.network.UDPWrite(s.handle, p)
+	s.countWrite(int(n))
 	return int(n), err
 }
 
 func (s *swiftUDPSession) Close() error {
 	if s.markClosed() {
 		s.engine.unregisterUDP(s.handle)
+		close(s.closing)
 		return s.engine.network.UDPClose(s.handle)
 	}
 	return nil
@@ -75,15 +107,24 @@ func (s *swiftUDPSession) LocalAddr() net.Addr {
 	return &net.UDPAddr{}
 }
 
-func (s *swiftUDPSession) SetDeadline(time.Time) error {
-	return nil
+func (s *swiftUDPSession) SetDeadline(t time.Time) error {
+	if err := s.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return s.SetWriteDeadline(t)
 }
 
-func (s *swiftUDPSession) SetReadDeadline(time.Time) error {
+func (s *swiftUDPSession) SetReadDeadline(t time.Time) error {
+	s.readDeadline.set(t)
 	return nil
 }
 
-func (s *swiftUDPSession) SetWriteDeadline(time.Time) error {
+func (s *swiftUDPSession) SetWriteDeadline(t time.Time) error {
+	if t.IsZero() {
+		s.writeDeadline.Store(nil)
+		return nil
+	}
+	s.writeDeadline.Store(&t)
 	return nil
 }
 
@@ -94,13 +135,22 @@ func (s *swiftUDPSession) enqueue(payload []byte) {
 		return
 	}
 	s.mu.Unlock()
-	s.recvQueue <- append([]byte(nil), payload...)
+	s.touchActivity()
+
+	// close() (from a Swift-driven UDPDidClose or the idle sweeper) can run
+	// concurrently with this call right after the s.closed check above. It
+	// closes s.closing, never recvQueue, so send under select on both so a
+	// full recvQueue cannot block this call forever once the session closes.
+	select {
+	case s.recvQueue <- append([]byte(nil), payload...):
+	case <-s.closing:
+	}
 }
 
 func (s *swiftUDPSession) close() {
 	if s.markClosed() {
 		s.engine.unregisterUDP(s.handle)
-		close(s.recvQueue)
+		close(s.closing)
 	}
 }
 
@@ -111,6 +161,7 @@ func (s *swiftUDPSession) markClosed() bool {
 		return false
 	}
 	s.closed = true
+	s.engine.udpClosed.Add(1)
 	return true
 }
 
@@ -119,3 +170,46 @@ func (s *swiftUDPSession) isClosed() bool {
 	defer s.mu.Unlock()
 	return s.closed
 }
+
+func (s *swiftUDPSession) touchActivity() {
+	s.lastActivity.Store(time.Now().UnixNano())
+}
+
+// idleFor reports how long the session has gone without a read or write.
+func (s *swiftUDPSession) idleFor() time.Duration {
+	last := s.lastActivity.Load()
+	if last == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, last))
+}
+
+// countRead and countWrite accumulate bytes crossing the FFI boundary into
+// both the per-session and engine-wide totals surfaced by Engine.Snapshot.
+func (s *swiftUDPSession) countRead(n int) {
+	if n <= 0 {
+		return
+	}
+	s.bytesIn.Add(int64(n))
+	s.engine.addBytesIn(int64(n))
+}
+
+func (s *swiftUDPSession) countWrite(n int) {
+	if n <= 0 {
+		return
+	}
+	s.bytesOut.Add(int64(n))
+	s.engine.addBytesOut(int64(n))
+}
+
+// flowStat reports this session's contribution to Engine.Snapshot's top-N
+// flow breakdown.
+func (s *swiftUDPSession) flowStat() FlowStat {
+	return FlowStat{
+		Handle: s.handle,
+		Proto:  "udp",
+		Remote: s.remote.String(),
+		Bytes:  s.bytesIn.Load() + s.bytesOut.Load(),
+		Age:    time.Since(s.opened),
+	}
+}